@@ -0,0 +1,40 @@
+package plugin
+
+// Config is the plugin-specific configuration block supplied via the rollout's
+// trafficRouting.plugins args for this plugin.
+type Config struct {
+	// ExperimentStableWeight overrides the stable service weight that HandleExperiment
+	// applies while an experiment is active. When nil, the stable weight is derived as
+	// the remainder after the canary weight and all additional experiment weights are
+	// subtracted from 100, rather than a fixed percentage.
+	ExperimentStableWeight *int32 `json:"experimentStableWeight,omitempty"`
+
+	// ExperimentBackendPortName, when set, is the preferred named port to route to on
+	// an experiment backend service. Checked before falling back to the canary service's
+	// port and the standard HTTP port names.
+	ExperimentBackendPortName *string `json:"experimentBackendPortName,omitempty"`
+
+	// ExperimentBackendPortNumber, when set, is the preferred port number to route to on
+	// an experiment backend service. Takes precedence over ExperimentBackendPortName.
+	ExperimentBackendPortNumber *int32 `json:"experimentBackendPortNumber,omitempty"`
+
+	// RouteKind selects which Gateway API route kind the rollout's traffic is managed
+	// through. One of "HTTPRoute" (the default when empty), "GRPCRoute" or "TLSRoute".
+	RouteKind string `json:"routeKind,omitempty"`
+
+	// RouteName is the name of the Gateway API route object (of the kind named by
+	// RouteKind) that fronts this rollout. Only read by RpcPlugin.RemoveManagedRoutes,
+	// which has to fetch the route itself rather than receiving it as an argument.
+	RouteName string `json:"routeName,omitempty"`
+
+	// Namespace is the namespace of the route named by RouteName, defaulting to the
+	// rollout's own namespace when empty.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Gateway API route kinds supported as the value of Config.RouteKind.
+const (
+	RouteKindHTTPRoute = "HTTPRoute"
+	RouteKindGRPCRoute = "GRPCRoute"
+	RouteKindTLSRoute  = "TLSRoute"
+)
@@ -6,45 +6,139 @@ import (
 
 	"github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
 	"github.com/sirupsen/logrus"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	gatewayApiClientset "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
 )
 
 // HandleExperiment adds experiment services to the HTTPRoute if an experiment is active
-// or removes them if the experiment has completed
-func HandleExperiment(ctx context.Context, clientset *kubernetes.Clientset, gatewayClient *gatewayApiClientset.Clientset, logger *logrus.Entry, rollout *v1alpha1.Rollout, httpRoute *gatewayv1.HTTPRoute) error {
-	// Find the matching rule for our rollout first (needed for both adding and removing)
-	ruleIdx := -1
+// or removes them if the experiment has completed. Every rule in the HTTPRoute whose
+// backendRefs reference the rollout's stable or canary service is treated as a match,
+// since a single rollout can be fronted by several rules (header matches, path prefixes,
+// mirrored routes, etc).
+func HandleExperiment(ctx context.Context, clientset kubernetes.Interface, gatewayClient *gatewayApiClientset.Clientset, logger *logrus.Entry, rollout *v1alpha1.Rollout, httpRoute *gatewayv1.HTTPRoute, pluginConfig Config) error {
+	return handleExperimentRoute(ctx, clientset, logger, rollout, NewHTTPRouteHandler(httpRoute), pluginConfig)
+}
+
+// HandleGRPCExperiment is the GRPCRoute counterpart of HandleExperiment.
+func HandleGRPCExperiment(ctx context.Context, clientset kubernetes.Interface, gatewayClient *gatewayApiClientset.Clientset, logger *logrus.Entry, rollout *v1alpha1.Rollout, grpcRoute *gatewayv1.GRPCRoute, pluginConfig Config) error {
+	return handleExperimentRoute(ctx, clientset, logger, rollout, NewGRPCRouteHandler(grpcRoute), pluginConfig)
+}
+
+// HandleTLSExperiment is the TLSRoute counterpart of HandleExperiment. TLSRoute carries
+// no HTTP semantics, so traffic is still shifted purely by backendRef weight.
+func HandleTLSExperiment(ctx context.Context, clientset kubernetes.Interface, gatewayClient *gatewayApiClientset.Clientset, logger *logrus.Entry, rollout *v1alpha1.Rollout, tlsRoute *gatewayv1alpha2.TLSRoute, pluginConfig Config) error {
+	return handleExperimentRoute(ctx, clientset, logger, rollout, NewTLSRouteHandler(tlsRoute), pluginConfig)
+}
+
+// HandleExperimentForRollout dispatches to the HandleExperiment variant matching the
+// route kind the rollout is configured to use (pluginConfig.RouteKind), so callers that
+// hold all three possible route objects don't need to know which one is live.
+func HandleExperimentForRollout(ctx context.Context, clientset kubernetes.Interface, gatewayClient *gatewayApiClientset.Clientset, logger *logrus.Entry, rollout *v1alpha1.Rollout, httpRoute *gatewayv1.HTTPRoute, grpcRoute *gatewayv1.GRPCRoute, tlsRoute *gatewayv1alpha2.TLSRoute, pluginConfig Config) error {
+	switch pluginConfig.RouteKind {
+	case RouteKindGRPCRoute:
+		return HandleGRPCExperiment(ctx, clientset, gatewayClient, logger, rollout, grpcRoute, pluginConfig)
+	case RouteKindTLSRoute:
+		return HandleTLSExperiment(ctx, clientset, gatewayClient, logger, rollout, tlsRoute, pluginConfig)
+	case "", RouteKindHTTPRoute:
+		return HandleExperiment(ctx, clientset, gatewayClient, logger, rollout, httpRoute, pluginConfig)
+	default:
+		return fmt.Errorf("unsupported route kind %q for rollout %s", pluginConfig.RouteKind, rollout.Name)
+	}
+}
+
+// handleExperimentRoute is the route-kind-agnostic core shared by HandleExperiment,
+// HandleGRPCExperiment and HandleTLSExperiment.
+func handleExperimentRoute(ctx context.Context, clientset kubernetes.Interface, logger *logrus.Entry, rollout *v1alpha1.Rollout, route RouteHandler, pluginConfig Config) error {
 	stableService := rollout.Spec.Strategy.Canary.StableService
 	canaryService := rollout.Spec.Strategy.Canary.CanaryService
 
-	for i, rule := range httpRoute.Spec.Rules {
-		if ruleIdx != -1 {
-			break
+	ruleIdxs := matchingRuleIndexes(route, stableService, canaryService)
+	if len(ruleIdxs) == 0 {
+		return fmt.Errorf("no matching rule found for rollout %s", rollout.Name)
+	}
+
+	// Check if experiment is active in the rollout
+	isExperimentActive := rollout.Spec.Strategy.Canary != nil && rollout.Status.Canary.CurrentExperiment != ""
+
+	var errs []error
+	for _, ruleIdx := range ruleIdxs {
+		if err := handleExperimentRule(ctx, clientset, logger, rollout, route, ruleIdx, stableService, canaryService, isExperimentActive, pluginConfig); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %w", ruleIdx, err))
 		}
-		for _, backendRef := range rule.BackendRefs {
-			if string(backendRef.Name) == stableService || string(backendRef.Name) == canaryService {
-				ruleIdx = i
+	}
+
+	// Recorded once per route, not per rule: rollout.Status.Canary.Weights.Additional is
+	// the same set of plugin-added experiment services regardless of which rule(s) it was
+	// applied to, so deriving the managed set here - rather than inside each
+	// handleExperimentRule call - means one matching rule's backendRefs can never clobber
+	// what another matching rule recorded.
+	if isExperimentActive && rollout.Status.Canary.Weights != nil && len(rollout.Status.Canary.Weights.Additional) > 0 {
+		recordManagedExperimentBackends(route, rollout.Status.Canary.Weights.Additional)
+	}
+
+	// Cleared once per route as well, after every matching rule has been cleaned up, so
+	// each rule's cleanup reads the same recorded set.
+	if !isExperimentActive {
+		route.SetAnnotation(ExperimentBackendsAnnotation, "")
+	}
+
+	return errors.NewAggregate(errs)
+}
+
+// experimentStableWeight returns the stable service weight to apply while an experiment
+// is active. If the plugin config specifies an explicit override, that value wins.
+// Otherwise the weight is derived as the true remainder after the canary weight and all
+// additional experiment weights are subtracted from 100, matching what argo-rollouts
+// actually computed for the stable service rather than assuming a fixed split. Only
+// called once an experiment is confirmed active, since Status.Canary.Weights is nil
+// until the controller starts weighted-traffic bookkeeping.
+func experimentStableWeight(rollout *v1alpha1.Rollout, pluginConfig Config) int32 {
+	if pluginConfig.ExperimentStableWeight != nil {
+		return *pluginConfig.ExperimentStableWeight
+	}
+
+	if rollout.Status.Canary.Weights == nil {
+		return 100
+	}
+
+	weight := int32(100) - rollout.Status.Canary.Weights.Canary.Weight
+	for _, additional := range rollout.Status.Canary.Weights.Additional {
+		weight -= additional.Weight
+	}
+	if weight < 0 {
+		weight = 0
+	}
+	return weight
+}
+
+// matchingRuleIndexes returns the indexes of every rule in route whose backendRefs
+// reference the stable or canary service.
+func matchingRuleIndexes(route RouteHandler, stableService, canaryService string) []int {
+	var ruleIdxs []int
+	for i := 0; i < route.ListRules(); i++ {
+		for _, backendRef := range route.GetBackendRefs(i) {
+			if backendRef.Name == stableService || backendRef.Name == canaryService {
+				ruleIdxs = append(ruleIdxs, i)
 				break
 			}
 		}
 	}
+	return ruleIdxs
+}
 
-	if ruleIdx == -1 {
-		return fmt.Errorf("no matching rule found for rollout %s", rollout.Name)
-	}
-
-	// Check if experiment is active in the rollout
-	isExperimentActive := rollout.Spec.Strategy.Canary != nil && rollout.Status.Canary.CurrentExperiment != ""
+// handleExperimentRule applies the experiment backendRef additions/removals and stable
+// weight rebalancing to a single rule.
+func handleExperimentRule(ctx context.Context, clientset kubernetes.Interface, logger *logrus.Entry, rollout *v1alpha1.Rollout, route RouteHandler, ruleIdx int, stableService, canaryService string, isExperimentActive bool, pluginConfig Config) error {
+	backendRefs := route.GetBackendRefs(ruleIdx)
 
-	// Check if we have experiment services in the HTTPRoute
+	// Check if we have experiment services in the route
 	hasExperimentServices := false
-	for _, backendRef := range httpRoute.Spec.Rules[ruleIdx].BackendRefs {
+	for _, backendRef := range backendRefs {
 		// Identify experiment services (they'll be different from stable and canary)
-		serviceName := string(backendRef.Name)
-		if serviceName != stableService && serviceName != canaryService {
+		if backendRef.Name != stableService && backendRef.Name != canaryService {
 			hasExperimentServices = true
 			break
 		}
@@ -55,110 +149,151 @@ func HandleExperiment(ctx context.Context, clientset *kubernetes.Clientset, gate
 		logger.Info(fmt.Sprintf("Found active experiment %s", rollout.Status.Canary.CurrentExperiment))
 
 		// Get the experiment services from the rollout status
-		if len(rollout.Status.Canary.Weights.Additional) == 0 {
+		if rollout.Status.Canary.Weights == nil || len(rollout.Status.Canary.Weights.Additional) == 0 {
 			logger.Info("No experiment services found in rollout status, skipping experiment service addition")
 			return nil
 		}
 
-		// First, update the stable service weight to ensure proper traffic distribution
-		stableWeight := int32(45) // Default to 45% for the stable service when experiments are active
-		for i, backendRef := range httpRoute.Spec.Rules[ruleIdx].BackendRefs {
-			if string(backendRef.Name) == stableService {
-				httpRoute.Spec.Rules[ruleIdx].BackendRefs[i].Weight = &stableWeight
+		// First, update the stable service weight to ensure proper traffic distribution.
+		// This must be applied to the backendRefs slice below, not via route.SetWeight:
+		// backendRefs is a snapshot copied out of the route, and the SetBackendRefs call
+		// at the end of this branch rewrites the whole rule from that snapshot, which
+		// would otherwise silently discard an update made directly on the live route.
+		stableWeight := experimentStableWeight(rollout, pluginConfig)
+		for i, backendRef := range backendRefs {
+			if backendRef.Name == stableService {
+				backendRefs[i].Weight = &stableWeight
 				break
 			}
 		}
 
+		// Resolve the canary's own port from this rule so experiment backends that share
+		// its selector can fall back to the same port rather than guessing.
+		var canaryPort *gatewayv1.PortNumber
+		for _, backendRef := range backendRefs {
+			if backendRef.Name == canaryService {
+				canaryPort = backendRef.Port
+				break
+			}
+		}
+		canarySvc, err := getService(ctx, clientset, rollout.Namespace, canaryService)
+		if err != nil {
+			logger.Warn(err.Error())
+			canarySvc = nil
+		}
+
 		// Process each additional service (these are the experiment services)
+		var errs []error
 		for _, additionalDestination := range rollout.Status.Canary.Weights.Additional {
 			serviceName := additionalDestination.ServiceName
 			weight := additionalDestination.Weight
 
 			// Check if this service is already in the backend refs
 			exists := false
-			for _, backendRef := range httpRoute.Spec.Rules[ruleIdx].BackendRefs {
-				if string(backendRef.Name) == serviceName {
+			for _, backendRef := range backendRefs {
+				if backendRef.Name == serviceName {
 					exists = true
 					break
 				}
 			}
 
 			if !exists {
-				logger.Info(fmt.Sprintf("Adding experiment service to HTTPRoute: %s with weight %d", serviceName, weight))
+				logger.Info(fmt.Sprintf("Adding experiment service to route: %s with weight %d", serviceName, weight))
 
-				// Get the actual service port by querying the Kubernetes API
-				service, err := clientset.CoreV1().Services(rollout.Namespace).Get(ctx, serviceName, metav1.GetOptions{})
+				service, err := getService(ctx, clientset, rollout.Namespace, serviceName)
 				if err != nil {
-					logger.Warn(fmt.Sprintf("Failed to get service %s: %v", serviceName, err))
+					errs = append(errs, err)
 					continue
 				}
 
-				// Default to 8080 if we can't determine the port
-				port := gatewayv1.PortNumber(8080)
-
-				// Find port by service port name
-				portName := "http" // Common name for HTTP ports
-				for _, servicePort := range service.Spec.Ports {
-					if servicePort.Name == portName {
-						port = gatewayv1.PortNumber(servicePort.Port)
-						break
-					}
-				}
-
-				// If no named port found, use the first port
-				if len(service.Spec.Ports) > 0 && port == 8080 {
-					port = gatewayv1.PortNumber(service.Spec.Ports[0].Port)
+				port, err := resolveExperimentBackendPort(service, canarySvc, canaryPort, pluginConfig)
+				if err != nil {
+					errs = append(errs, err)
+					continue
 				}
 
 				// Add the experiment service to the backend refs
-				namespace := gatewayv1.Namespace(rollout.Namespace)
-				httpRoute.Spec.Rules[ruleIdx].BackendRefs = append(httpRoute.Spec.Rules[ruleIdx].BackendRefs, gatewayv1.HTTPBackendRef{
-					BackendRef: gatewayv1.BackendRef{
-						BackendObjectReference: gatewayv1.BackendObjectReference{
-							Name:      gatewayv1.ObjectName(serviceName),
-							Namespace: &namespace,
-							Port:      &port,
-						},
-						Weight: &weight,
-					},
+				namespace := rollout.Namespace
+				backendRefs = append(backendRefs, BackendRef{
+					Name:      serviceName,
+					Namespace: &namespace,
+					Port:      &port,
+					Weight:    &weight,
 				})
 			}
 		}
-		return nil
+		route.SetBackendRefs(ruleIdx, backendRefs)
+		return errors.NewAggregate(errs)
 	}
 
 	// CASE 2: Experiment is not active but we have experiment services - clean them up
 	if !isExperimentActive && hasExperimentServices {
-		logger.Info("Experiment is no longer active, removing experiment services from HTTPRoute")
+		logger.Info("Experiment is no longer active, removing experiment services from route")
+
+		// Only backends the plugin itself recorded adding are removed here - a backendRef
+		// a user added manually (a mirror, a shadow backend, an auxiliary header-routed
+		// service) is simply not stable or canary either, but it isn't ours to delete. A
+		// route with no recorded set at all falls back to removing every non-stable,
+		// non-canary backend (see isManagedExperimentBackend).
+		managedBackends := splitNames(route.Annotations()[ExperimentBackendsAnnotation])
 
 		// Reset the stable service weight back to 100
 		stableWeight := int32(100)
 
-		// Create a new backend refs slice with only stable and canary services
-		filteredBackendRefs := []gatewayv1.HTTPBackendRef{}
-
-		for _, backendRef := range httpRoute.Spec.Rules[ruleIdx].BackendRefs {
-			serviceName := string(backendRef.Name)
+		// Create a new backend refs slice with only stable, canary, and unmanaged services
+		filteredBackendRefs := []BackendRef{}
 
-			if serviceName == stableService {
+		for _, backendRef := range backendRefs {
+			switch {
+			case backendRef.Name == stableService:
 				// Keep stable service but update its weight
 				backendRef.Weight = &stableWeight
 				filteredBackendRefs = append(filteredBackendRefs, backendRef)
-			} else if serviceName == canaryService {
+			case backendRef.Name == canaryService:
 				// Keep canary service with weight 0
 				zeroWeight := int32(0)
 				backendRef.Weight = &zeroWeight
 				filteredBackendRefs = append(filteredBackendRefs, backendRef)
-			} else {
-				// Skip other services (experiment services)
-				logger.Info(fmt.Sprintf("Removing experiment service from HTTPRoute: %s", serviceName))
+			case isManagedExperimentBackend(backendRef.Name, managedBackends):
+				// Skip experiment services the plugin added
+				logger.Info(fmt.Sprintf("Removing experiment service from route: %s", backendRef.Name))
+			default:
+				filteredBackendRefs = append(filteredBackendRefs, backendRef)
 			}
 		}
 
 		// Replace the backend refs with our filtered list
-		httpRoute.Spec.Rules[ruleIdx].BackendRefs = filteredBackendRefs
-		logger.Info("Experiment services removed from HTTPRoute")
+		route.SetBackendRefs(ruleIdx, filteredBackendRefs)
+		logger.Info("Experiment services removed from route")
 	}
 
 	return nil
 }
+
+// recordManagedExperimentBackends writes ExperimentBackendsAnnotation with the union of
+// whatever was already recorded there and the experiment service names additional
+// lists, so cleanup and Finalize only ever remove backends the plugin itself added via
+// rollout.Status.Canary.Weights.Additional - never a manually configured mirror,
+// shadow, or auxiliary backendRef that happens to share a rule with stable/canary - and
+// can do so even if the in-memory rollout status has been wiped by a controller
+// restart. Deriving the set from additional rather than from a rule's backendRefs is
+// what keeps a pre-existing, non-plugin-managed backendRef out of the annotation in the
+// first place.
+func recordManagedExperimentBackends(route RouteHandler, additional []v1alpha1.WeightDestination) {
+	existing := splitNames(route.Annotations()[ExperimentBackendsAnnotation])
+	seen := make(map[string]bool, len(existing)+len(additional))
+	var names []string
+	for _, name := range existing {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, dest := range additional {
+		if !seen[dest.ServiceName] {
+			seen[dest.ServiceName] = true
+			names = append(names, dest.ServiceName)
+		}
+	}
+	route.SetAnnotation(ExperimentBackendsAnnotation, joinNames(names))
+}
@@ -0,0 +1,299 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func testLogger() *logrus.Entry {
+	return logrus.NewEntry(logrus.New())
+}
+
+func weightPtr(w int32) *int32 {
+	return &w
+}
+
+func portPtr(p int32) *gatewayv1.PortNumber {
+	port := gatewayv1.PortNumber(p)
+	return &port
+}
+
+// twoRuleHTTPRoute builds an HTTPRoute with two rules that both reference the same
+// stable/canary services but differ in their match conditions - e.g. a path prefix
+// rule and a header-based rule fronting the same rollout.
+func twoRuleHTTPRoute(stableService, canaryService string) *gatewayv1.HTTPRoute {
+	pathValue := "/"
+	headerValue := "v2"
+	rule := func(path *string) gatewayv1.HTTPRouteRule {
+		var matches []gatewayv1.HTTPRouteMatch
+		if path != nil {
+			matches = []gatewayv1.HTTPRouteMatch{{Path: &gatewayv1.HTTPPathMatch{Value: path}}}
+		} else {
+			matches = []gatewayv1.HTTPRouteMatch{{Headers: []gatewayv1.HTTPHeaderMatch{{Name: "X-Version", Value: headerValue}}}}
+		}
+		return gatewayv1.HTTPRouteRule{
+			Matches: matches,
+			BackendRefs: []gatewayv1.HTTPBackendRef{
+				{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(stableService)}, Weight: weightPtr(100)}},
+				{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(canaryService)}, Weight: weightPtr(0)}},
+			},
+		}
+	}
+	return &gatewayv1.HTTPRoute{
+		Spec: gatewayv1.HTTPRouteSpec{
+			Rules: []gatewayv1.HTTPRouteRule{rule(&pathValue), rule(nil)},
+		},
+	}
+}
+
+func TestHandleExperiment_MultiRuleHTTPRoute(t *testing.T) {
+	stableService := "my-app-stable"
+	canaryService := "my-app-canary"
+	experimentService := "my-app-experiment"
+
+	httpRoute := twoRuleHTTPRoute(stableService, canaryService)
+
+	clientset := k8sfake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: canaryService, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: experimentService, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 8090}}},
+		},
+	)
+
+	rollout := &v1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "default"},
+		Spec: v1alpha1.RolloutSpec{
+			Strategy: v1alpha1.RolloutStrategy{
+				Canary: &v1alpha1.CanaryStrategy{
+					StableService: stableService,
+					CanaryService: canaryService,
+				},
+			},
+		},
+		Status: v1alpha1.RolloutStatus{
+			Canary: v1alpha1.CanaryStatus{
+				CurrentExperiment: "my-app-experiment-run",
+				Weights: &v1alpha1.TrafficWeights{
+					Canary:     v1alpha1.WeightDestination{Weight: 20},
+					Additional: []v1alpha1.WeightDestination{{ServiceName: experimentService, Weight: 10}},
+				},
+			},
+		},
+	}
+
+	err := HandleExperiment(context.Background(), clientset, nil, testLogger(), rollout, httpRoute, Config{})
+	if err != nil {
+		t.Fatalf("HandleExperiment returned error: %v", err)
+	}
+
+	wantStableWeight := int32(70) // 100 - 20 (canary) - 10 (additional)
+	for ruleIdx, rule := range httpRoute.Spec.Rules {
+		var gotStableWeight, gotExperimentWeight *int32
+		foundExperiment := false
+		for _, backendRef := range rule.BackendRefs {
+			switch string(backendRef.Name) {
+			case stableService:
+				gotStableWeight = backendRef.Weight
+			case experimentService:
+				foundExperiment = true
+				gotExperimentWeight = backendRef.Weight
+			}
+		}
+		if gotStableWeight == nil || *gotStableWeight != wantStableWeight {
+			t.Errorf("rule %d: stable weight = %v, want %d", ruleIdx, gotStableWeight, wantStableWeight)
+		}
+		if !foundExperiment {
+			t.Errorf("rule %d: experiment backend %s not added", ruleIdx, experimentService)
+		}
+		if gotExperimentWeight == nil || *gotExperimentWeight != 10 {
+			t.Errorf("rule %d: experiment weight = %v, want 10", ruleIdx, gotExperimentWeight)
+		}
+	}
+}
+
+func TestHandleExperiment_NoExperimentNoWeightsPanic(t *testing.T) {
+	stableService := "my-app-stable"
+	canaryService := "my-app-canary"
+	httpRoute := twoRuleHTTPRoute(stableService, canaryService)
+	clientset := k8sfake.NewSimpleClientset()
+
+	rollout := &v1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "default"},
+		Spec: v1alpha1.RolloutSpec{
+			Strategy: v1alpha1.RolloutStrategy{
+				Canary: &v1alpha1.CanaryStrategy{
+					StableService: stableService,
+					CanaryService: canaryService,
+				},
+			},
+		},
+		// Status.Canary.Weights left nil, as it is until the controller starts
+		// weighted-traffic bookkeeping - this must not panic.
+	}
+
+	if err := HandleExperiment(context.Background(), clientset, nil, testLogger(), rollout, httpRoute, Config{}); err != nil {
+		t.Fatalf("HandleExperiment returned error: %v", err)
+	}
+}
+
+// TestHandleExperiment_PreservesManuallyManagedBackend guards against a pre-existing,
+// non-plugin-managed backendRef (a mirror/shadow service a user added to the route
+// directly) being swept into ExperimentBackendsAnnotation just because it sits on the
+// same rule the plugin is rebalancing, and then deleted once the experiment ends.
+func TestHandleExperiment_PreservesManuallyManagedBackend(t *testing.T) {
+	stableService := "my-app-stable"
+	canaryService := "my-app-canary"
+	experimentService := "my-app-experiment"
+	shadowService := "shadow-svc"
+
+	httpRoute := &gatewayv1.HTTPRoute{
+		Spec: gatewayv1.HTTPRouteSpec{
+			Rules: []gatewayv1.HTTPRouteRule{
+				{
+					BackendRefs: []gatewayv1.HTTPBackendRef{
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(stableService)}, Weight: weightPtr(100)}},
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(canaryService)}, Weight: weightPtr(0)}},
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(shadowService)}, Weight: weightPtr(0)}},
+					},
+				},
+			},
+		},
+	}
+
+	clientset := k8sfake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: canaryService, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: experimentService, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 8090}}},
+		},
+	)
+
+	rollout := &v1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "default"},
+		Spec: v1alpha1.RolloutSpec{
+			Strategy: v1alpha1.RolloutStrategy{
+				Canary: &v1alpha1.CanaryStrategy{
+					StableService: stableService,
+					CanaryService: canaryService,
+				},
+			},
+		},
+		Status: v1alpha1.RolloutStatus{
+			Canary: v1alpha1.CanaryStatus{
+				CurrentExperiment: "my-app-experiment-run",
+				Weights: &v1alpha1.TrafficWeights{
+					Canary:     v1alpha1.WeightDestination{Weight: 20},
+					Additional: []v1alpha1.WeightDestination{{ServiceName: experimentService, Weight: 10}},
+				},
+			},
+		},
+	}
+
+	if err := HandleExperiment(context.Background(), clientset, nil, testLogger(), rollout, httpRoute, Config{}); err != nil {
+		t.Fatalf("HandleExperiment (active) returned error: %v", err)
+	}
+
+	if managed := splitNames(httpRoute.Annotations[ExperimentBackendsAnnotation]); len(managed) != 1 || managed[0] != experimentService {
+		t.Fatalf("%s = %v, want only [%s]", ExperimentBackendsAnnotation, managed, experimentService)
+	}
+
+	// Experiment ends: cleanup must remove the plugin's own experiment backend but must
+	// not touch the shadow service it never added.
+	rollout.Status.Canary.CurrentExperiment = ""
+	if err := HandleExperiment(context.Background(), clientset, nil, testLogger(), rollout, httpRoute, Config{}); err != nil {
+		t.Fatalf("HandleExperiment (cleanup) returned error: %v", err)
+	}
+
+	gotNames := map[string]bool{}
+	for _, backendRef := range httpRoute.Spec.Rules[0].BackendRefs {
+		gotNames[string(backendRef.Name)] = true
+	}
+	if !gotNames[shadowService] {
+		t.Errorf("shadow service %s was removed, want it preserved", shadowService)
+	}
+	if gotNames[experimentService] {
+		t.Errorf("experiment service %s was not removed", experimentService)
+	}
+}
+
+// TestHandleExperiment_UnionsManagedBackendsAcrossRules guards against one matching
+// rule's recorded backends clobbering another's when a route has several rules fronting
+// the same rollout.
+func TestHandleExperiment_UnionsManagedBackendsAcrossRules(t *testing.T) {
+	stableService := "my-app-stable"
+	canaryService := "my-app-canary"
+	experimentService := "my-app-experiment"
+	shadowService := "shadow-svc"
+
+	ruleWithShadow := gatewayv1.HTTPRouteRule{
+		BackendRefs: []gatewayv1.HTTPBackendRef{
+			{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(stableService)}, Weight: weightPtr(100)}},
+			{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(canaryService)}, Weight: weightPtr(0)}},
+			{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(shadowService)}, Weight: weightPtr(0)}},
+		},
+	}
+	plainRule := gatewayv1.HTTPRouteRule{
+		BackendRefs: []gatewayv1.HTTPBackendRef{
+			{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(stableService)}, Weight: weightPtr(100)}},
+			{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(canaryService)}, Weight: weightPtr(0)}},
+		},
+	}
+	httpRoute := &gatewayv1.HTTPRoute{
+		Spec: gatewayv1.HTTPRouteSpec{Rules: []gatewayv1.HTTPRouteRule{ruleWithShadow, plainRule}},
+	}
+
+	clientset := k8sfake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: canaryService, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: experimentService, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 8090}}},
+		},
+	)
+
+	rollout := &v1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "default"},
+		Spec: v1alpha1.RolloutSpec{
+			Strategy: v1alpha1.RolloutStrategy{
+				Canary: &v1alpha1.CanaryStrategy{
+					StableService: stableService,
+					CanaryService: canaryService,
+				},
+			},
+		},
+		Status: v1alpha1.RolloutStatus{
+			Canary: v1alpha1.CanaryStatus{
+				CurrentExperiment: "my-app-experiment-run",
+				Weights: &v1alpha1.TrafficWeights{
+					Canary:     v1alpha1.WeightDestination{Weight: 20},
+					Additional: []v1alpha1.WeightDestination{{ServiceName: experimentService, Weight: 10}},
+				},
+			},
+		},
+	}
+
+	if err := HandleExperiment(context.Background(), clientset, nil, testLogger(), rollout, httpRoute, Config{}); err != nil {
+		t.Fatalf("HandleExperiment returned error: %v", err)
+	}
+
+	managed := splitNames(httpRoute.Annotations[ExperimentBackendsAnnotation])
+	if len(managed) != 1 || managed[0] != experimentService {
+		t.Fatalf("%s = %v, want only [%s] - processing rule 1 after rule 0 must not drop rule 0's managed backends nor pick up its shadow service", ExperimentBackendsAnnotation, managed, experimentService)
+	}
+}
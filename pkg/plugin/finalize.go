@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+
+	"github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ExperimentBackendsAnnotation records, as a comma-separated list, the experiment
+// backend service names the plugin has added to a route. Both the steady-state cleanup
+// in handleExperimentRule and Finalize read it to know exactly what to remove, so a
+// backendRef a user added to the route manually (a mirror, a shadow backend, an
+// auxiliary header-routed service) is never mistaken for one of ours - including across
+// a controller restart following an abort or delete, where the rollout's in-memory
+// status has already been cleared but the annotation on the route survives. A route
+// that carries no such annotation gets the fallback described on
+// isManagedExperimentBackend instead.
+const ExperimentBackendsAnnotation = "gatewayapi.rollouts.argoproj.io/experiment-backends"
+
+// Finalize restores route to 100% stable / 0% canary and strips every experiment
+// backendRef the plugin previously added, regardless of whether the rollout is still
+// mid-experiment in memory. It is the entrypoint RpcPlugin.RemoveManagedRoutes calls so
+// an aborted, paused-then-deleted, or crashed rollout never leaves stranded experiment
+// backends behind.
+func Finalize(ctx context.Context, clientset kubernetes.Interface, logger *logrus.Entry, rollout *v1alpha1.Rollout, route RouteHandler) error {
+	stableService := rollout.Spec.Strategy.Canary.StableService
+	canaryService := rollout.Spec.Strategy.Canary.CanaryService
+
+	managedBackends := splitNames(route.Annotations()[ExperimentBackendsAnnotation])
+
+	for ruleIdx := 0; ruleIdx < route.ListRules(); ruleIdx++ {
+		backendRefs := route.GetBackendRefs(ruleIdx)
+
+		isMatch := false
+		for _, backendRef := range backendRefs {
+			if backendRef.Name == stableService || backendRef.Name == canaryService {
+				isMatch = true
+				break
+			}
+		}
+		if !isMatch {
+			continue
+		}
+
+		stableWeight := int32(100)
+		canaryWeight := int32(0)
+		filtered := []BackendRef{}
+		for _, backendRef := range backendRefs {
+			switch {
+			case backendRef.Name == stableService:
+				backendRef.Weight = &stableWeight
+				filtered = append(filtered, backendRef)
+			case backendRef.Name == canaryService:
+				backendRef.Weight = &canaryWeight
+				filtered = append(filtered, backendRef)
+			case isManagedExperimentBackend(backendRef.Name, managedBackends):
+				logger.Info("Finalize: removing managed experiment backend " + backendRef.Name)
+			default:
+				// Not stable, canary, or a backend the plugin recorded adding - leave it
+				// alone, it may be a manually configured mirror/auxiliary backend.
+				filtered = append(filtered, backendRef)
+			}
+		}
+
+		route.SetBackendRefs(ruleIdx, filtered)
+	}
+
+	route.SetAnnotation(ExperimentBackendsAnnotation, "")
+	return nil
+}
+
+// isManagedExperimentBackend reports whether name was recorded as a plugin-managed
+// experiment backend. When managedBackends is empty (no annotation was ever written,
+// e.g. for routes managed before this bookkeeping existed), every non-stable,
+// non-canary backendRef is treated as plugin-managed, matching the prior behavior.
+func isManagedExperimentBackend(name string, managedBackends []string) bool {
+	if len(managedBackends) == 0 {
+		return true
+	}
+	for _, managed := range managedBackends {
+		if managed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// joinNames renders names as the comma-separated form stored in
+// ExperimentBackendsAnnotation.
+func joinNames(names []string) string {
+	return strings.Join(names, ",")
+}
+
+// splitNames parses the comma-separated form stored in
+// ExperimentBackendsAnnotation, returning nil for an empty string.
+func splitNames(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	pluginTypes "github.com/argoproj/argo-rollouts/utils/plugin/types"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	gatewayApiClientset "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
+)
+
+// PluginName is the key this plugin's config block is stored under in
+// rollout.Spec.Strategy.Canary.TrafficRouting.Plugins.
+const PluginName = "argoproj-labs/gatewayAPI"
+
+// RpcPlugin implements the TrafficRouterPlugin RPC methods this package is responsible
+// for. It is the entrypoint argo-rollouts calls into; SetWeight/SetHeaderRoute/
+// SetMirrorRoute/Verified/Type/InitPlugin are registered alongside it in the plugin
+// binary and are out of scope for this change.
+type RpcPlugin struct {
+	Client              kubernetes.Interface
+	GatewayApiClientset gatewayApiClientset.Interface
+	LogCtx              *logrus.Entry
+}
+
+// RemoveManagedRoutes restores the rollout's route to 100% stable / 0% canary and
+// strips every experiment backendRef the plugin previously added. argo-rollouts calls
+// this when a rollout is aborted or deleted, so a crashed or abandoned experiment never
+// leaves stranded experiment backends shifting traffic away from stable.
+func (r *RpcPlugin) RemoveManagedRoutes(rollout *v1alpha1.Rollout) pluginTypes.RpcError {
+	pluginConfig, err := decodePluginConfig(rollout)
+	if err != nil {
+		return pluginTypes.RpcError{ErrorString: err.Error()}
+	}
+
+	ctx := context.TODO()
+	route, update, err := r.fetchRouteHandler(ctx, rollout, pluginConfig)
+	if err != nil {
+		return pluginTypes.RpcError{ErrorString: err.Error()}
+	}
+
+	if err := Finalize(ctx, r.Client, r.LogCtx, rollout, route); err != nil {
+		return pluginTypes.RpcError{ErrorString: err.Error()}
+	}
+
+	if err := update(ctx); err != nil {
+		return pluginTypes.RpcError{ErrorString: fmt.Sprintf("failed to persist finalized route: %v", err)}
+	}
+	return pluginTypes.RpcError{}
+}
+
+// decodePluginConfig extracts this plugin's Config block from the rollout's
+// trafficRouting.plugins args.
+func decodePluginConfig(rollout *v1alpha1.Rollout) (Config, error) {
+	var pluginConfig Config
+
+	trafficRouting := rollout.Spec.Strategy.Canary.TrafficRouting
+	if trafficRouting == nil || trafficRouting.Plugins == nil {
+		return pluginConfig, fmt.Errorf("rollout %s has no trafficRouting plugins configured", rollout.Name)
+	}
+
+	raw, ok := trafficRouting.Plugins[PluginName]
+	if !ok {
+		return pluginConfig, fmt.Errorf("rollout %s has no %s plugin config", rollout.Name, PluginName)
+	}
+
+	if err := json.Unmarshal(raw, &pluginConfig); err != nil {
+		return pluginConfig, fmt.Errorf("failed to unmarshal %s plugin config: %w", PluginName, err)
+	}
+	return pluginConfig, nil
+}
+
+// fetchRouteHandler fetches the live route named by pluginConfig.RouteName, of the kind
+// named by pluginConfig.RouteKind, and returns it wrapped in the matching RouteHandler
+// alongside an update func that persists whatever mutations were made through that
+// handler back to the API server.
+func (r *RpcPlugin) fetchRouteHandler(ctx context.Context, rollout *v1alpha1.Rollout, pluginConfig Config) (route RouteHandler, update func(context.Context) error, err error) {
+	if pluginConfig.RouteName == "" {
+		return nil, nil, fmt.Errorf("rollout %s plugin config has no routeName set", rollout.Name)
+	}
+
+	namespace := pluginConfig.Namespace
+	if namespace == "" {
+		namespace = rollout.Namespace
+	}
+
+	switch pluginConfig.RouteKind {
+	case RouteKindGRPCRoute:
+		client := r.GatewayApiClientset.GatewayV1().GRPCRoutes(namespace)
+		grpcRoute, err := client.Get(ctx, pluginConfig.RouteName, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get GRPCRoute %s/%s: %w", namespace, pluginConfig.RouteName, err)
+		}
+		update := func(ctx context.Context) error {
+			_, err := client.Update(ctx, grpcRoute, metav1.UpdateOptions{})
+			return err
+		}
+		return NewGRPCRouteHandler(grpcRoute), update, nil
+	case RouteKindTLSRoute:
+		client := r.GatewayApiClientset.GatewayV1alpha2().TLSRoutes(namespace)
+		tlsRoute, err := client.Get(ctx, pluginConfig.RouteName, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get TLSRoute %s/%s: %w", namespace, pluginConfig.RouteName, err)
+		}
+		update := func(ctx context.Context) error {
+			_, err := client.Update(ctx, tlsRoute, metav1.UpdateOptions{})
+			return err
+		}
+		return NewTLSRouteHandler(tlsRoute), update, nil
+	case "", RouteKindHTTPRoute:
+		client := r.GatewayApiClientset.GatewayV1().HTTPRoutes(namespace)
+		httpRoute, err := client.Get(ctx, pluginConfig.RouteName, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get HTTPRoute %s/%s: %w", namespace, pluginConfig.RouteName, err)
+		}
+		update := func(ctx context.Context) error {
+			_, err := client.Update(ctx, httpRoute, metav1.UpdateOptions{})
+			return err
+		}
+		return NewHTTPRouteHandler(httpRoute), update, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported route kind %q for rollout %s", pluginConfig.RouteKind, rollout.Name)
+	}
+}
@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayfake "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned/fake"
+)
+
+func rolloutWithPluginConfig(t *testing.T, stableService, canaryService string, pluginConfig Config) *v1alpha1.Rollout {
+	t.Helper()
+	raw, err := json.Marshal(pluginConfig)
+	if err != nil {
+		t.Fatalf("failed to marshal plugin config: %v", err)
+	}
+	return &v1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "default"},
+		Spec: v1alpha1.RolloutSpec{
+			Strategy: v1alpha1.RolloutStrategy{
+				Canary: &v1alpha1.CanaryStrategy{
+					StableService: stableService,
+					CanaryService: canaryService,
+					TrafficRouting: &v1alpha1.RolloutTrafficRouting{
+						Plugins: map[string]json.RawMessage{PluginName: raw},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRpcPlugin_RemoveManagedRoutes(t *testing.T) {
+	stableService := "my-app-stable"
+	canaryService := "my-app-canary"
+	experimentService := "my-app-experiment"
+
+	httpRoute := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app-route", Namespace: "default"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			Rules: []gatewayv1.HTTPRouteRule{
+				{
+					BackendRefs: []gatewayv1.HTTPBackendRef{
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(stableService)}, Weight: weightPtr(70)}},
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(canaryService)}, Weight: weightPtr(20)}},
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(experimentService)}, Weight: weightPtr(10)}},
+					},
+				},
+			},
+		},
+	}
+
+	rollout := rolloutWithPluginConfig(t, stableService, canaryService, Config{
+		RouteKind: RouteKindHTTPRoute,
+		RouteName: "my-app-route",
+	})
+	httpRoute.Annotations = map[string]string{ExperimentBackendsAnnotation: experimentService}
+
+	gatewayClient := gatewayfake.NewSimpleClientset(httpRoute)
+	r := &RpcPlugin{
+		Client:              k8sfake.NewSimpleClientset(),
+		GatewayApiClientset: gatewayClient,
+		LogCtx:              testLogger(),
+	}
+
+	if rpcErr := r.RemoveManagedRoutes(rollout); rpcErr.ErrorString != "" {
+		t.Fatalf("RemoveManagedRoutes returned error: %s", rpcErr.ErrorString)
+	}
+
+	persisted, err := gatewayClient.GatewayV1().HTTPRoutes("default").Get(context.Background(), "my-app-route", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to fetch persisted route: %v", err)
+	}
+
+	gotNames := map[string]*int32{}
+	for _, backendRef := range persisted.Spec.Rules[0].BackendRefs {
+		gotNames[string(backendRef.Name)] = backendRef.Weight
+	}
+	if w := gotNames[stableService]; w == nil || *w != 100 {
+		t.Errorf("persisted stable weight = %v, want 100", w)
+	}
+	if w := gotNames[canaryService]; w == nil || *w != 0 {
+		t.Errorf("persisted canary weight = %v, want 0", w)
+	}
+	if _, ok := gotNames[experimentService]; ok {
+		t.Errorf("experiment backend %s was not removed from the persisted route", experimentService)
+	}
+}
+
+func TestRpcPlugin_RemoveManagedRoutes_MissingPluginConfig(t *testing.T) {
+	rollout := &v1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "default"},
+		Spec: v1alpha1.RolloutSpec{
+			Strategy: v1alpha1.RolloutStrategy{
+				Canary: &v1alpha1.CanaryStrategy{StableService: "my-app-stable", CanaryService: "my-app-canary"},
+			},
+		},
+	}
+
+	r := &RpcPlugin{
+		Client:              k8sfake.NewSimpleClientset(),
+		GatewayApiClientset: gatewayfake.NewSimpleClientset(),
+		LogCtx:              testLogger(),
+	}
+
+	if rpcErr := r.RemoveManagedRoutes(rollout); rpcErr.ErrorString == "" {
+		t.Fatal("expected an error for a rollout with no gatewayAPI plugin config")
+	}
+}
+
+func TestRpcPlugin_RemoveManagedRoutes_GRPCRouteKind(t *testing.T) {
+	stableService := "my-app-stable"
+	canaryService := "my-app-canary"
+
+	grpcRoute := &gatewayv1.GRPCRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app-route", Namespace: "default"},
+		Spec: gatewayv1.GRPCRouteSpec{
+			Rules: []gatewayv1.GRPCRouteRule{
+				{
+					BackendRefs: []gatewayv1.GRPCBackendRef{
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(stableService)}, Weight: weightPtr(70)}},
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(canaryService)}, Weight: weightPtr(30)}},
+					},
+				},
+			},
+		},
+	}
+
+	rollout := rolloutWithPluginConfig(t, stableService, canaryService, Config{
+		RouteKind: RouteKindGRPCRoute,
+		RouteName: "my-app-route",
+	})
+
+	r := &RpcPlugin{
+		Client:              k8sfake.NewSimpleClientset(),
+		GatewayApiClientset: gatewayfake.NewSimpleClientset(grpcRoute),
+		LogCtx:              testLogger(),
+	}
+
+	if rpcErr := r.RemoveManagedRoutes(rollout); rpcErr.ErrorString != "" {
+		t.Fatalf("RemoveManagedRoutes returned error: %s", rpcErr.ErrorString)
+	}
+
+	persisted, err := r.GatewayApiClientset.GatewayV1().GRPCRoutes("default").Get(context.Background(), "my-app-route", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to fetch persisted route: %v", err)
+	}
+	for _, backendRef := range persisted.Spec.Rules[0].BackendRefs {
+		if string(backendRef.Name) == stableService && (backendRef.Weight == nil || *backendRef.Weight != 100) {
+			t.Errorf("persisted stable weight = %v, want 100", backendRef.Weight)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// standardHTTPPortNames are probed, in order, when neither the plugin config nor the
+// canary service give us a port to use for an experiment backend.
+var standardHTTPPortNames = []string{"http", "http-web", "web", "http2"}
+
+// PortResolutionError is returned when no usable port could be determined for an
+// experiment backend service, so the caller can surface it on the rollout status
+// instead of silently proceeding with a missing backend.
+type PortResolutionError struct {
+	ServiceName string
+	Reason      string
+}
+
+func (e *PortResolutionError) Error() string {
+	return fmt.Sprintf("unable to resolve port for experiment service %s: %s", e.ServiceName, e.Reason)
+}
+
+// resolveExperimentBackendPort determines which port to route traffic to on an
+// experiment service, using a best-effort chain of signals rather than assuming 8080:
+//  1. an explicit preferred port name/number from the plugin config
+//  2. the canary service's port, when the experiment service shares its selector/app label
+//  3. standard HTTP port names (http, http-web, web, http2)
+//  4. the first port declared on the service
+func resolveExperimentBackendPort(service *corev1.Service, canaryService *corev1.Service, canaryPort *gatewayv1.PortNumber, pluginConfig Config) (gatewayv1.PortNumber, error) {
+	if len(service.Spec.Ports) == 0 {
+		return 0, &PortResolutionError{ServiceName: service.Name, Reason: "service declares no ports"}
+	}
+
+	if pluginConfig.ExperimentBackendPortNumber != nil {
+		for _, servicePort := range service.Spec.Ports {
+			if servicePort.Port == *pluginConfig.ExperimentBackendPortNumber {
+				return gatewayv1.PortNumber(servicePort.Port), nil
+			}
+		}
+	}
+
+	if pluginConfig.ExperimentBackendPortName != nil {
+		if port, ok := portByName(service, *pluginConfig.ExperimentBackendPortName); ok {
+			return port, nil
+		}
+	}
+
+	if canaryPort != nil && canaryService != nil && sharesSelector(service, canaryService) {
+		return *canaryPort, nil
+	}
+
+	for _, portName := range standardHTTPPortNames {
+		if port, ok := portByName(service, portName); ok {
+			return port, nil
+		}
+	}
+
+	return gatewayv1.PortNumber(service.Spec.Ports[0].Port), nil
+}
+
+// portByName returns the port on service named portName, if present.
+func portByName(service *corev1.Service, portName string) (gatewayv1.PortNumber, bool) {
+	for _, servicePort := range service.Spec.Ports {
+		if servicePort.Name == portName {
+			return gatewayv1.PortNumber(servicePort.Port), true
+		}
+	}
+	return 0, false
+}
+
+// sharesSelector reports whether service and canaryService select the same pods. When
+// the canary's selector has an "app" label, only that label is compared (so an
+// experiment service adding a version label on top of the canary's selector still
+// matches); otherwise every label of the canary's selector must be present on service
+// with the same value.
+func sharesSelector(service, canaryService *corev1.Service) bool {
+	if len(service.Spec.Selector) == 0 || len(canaryService.Spec.Selector) == 0 {
+		return false
+	}
+	if app, ok := canaryService.Spec.Selector["app"]; ok {
+		return service.Spec.Selector["app"] == app
+	}
+	for k, v := range canaryService.Spec.Selector {
+		if service.Spec.Selector[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// getService fetches a Service by name, wrapping a not-found/API error as a
+// PortResolutionError so callers can aggregate it alongside other rule errors.
+func getService(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*corev1.Service, error) {
+	service, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, &PortResolutionError{ServiceName: name, Reason: fmt.Sprintf("failed to get service: %v", err)}
+	}
+	return service, nil
+}
@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func svcWithPorts(ports ...corev1.ServicePort) *corev1.Service {
+	return &corev1.Service{Spec: corev1.ServiceSpec{Ports: ports}}
+}
+
+func TestResolveExperimentBackendPort_NoPortsIsError(t *testing.T) {
+	service := svcWithPorts()
+	if _, err := resolveExperimentBackendPort(service, nil, nil, Config{}); err == nil {
+		t.Fatal("expected error for a service with no declared ports")
+	}
+}
+
+func TestResolveExperimentBackendPort_ExplicitPortNumberWins(t *testing.T) {
+	service := svcWithPorts(
+		corev1.ServicePort{Name: "http", Port: 80},
+		corev1.ServicePort{Name: "grpc", Port: 9090},
+	)
+	pluginConfig := Config{ExperimentBackendPortNumber: int32Ptr(9090)}
+
+	got, err := resolveExperimentBackendPort(service, nil, nil, pluginConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 9090 {
+		t.Errorf("got port %d, want 9090", got)
+	}
+}
+
+func TestResolveExperimentBackendPort_ExplicitPortNumberMissFallsThroughToName(t *testing.T) {
+	service := svcWithPorts(corev1.ServicePort{Name: "http", Port: 80})
+	pluginConfig := Config{
+		ExperimentBackendPortNumber: int32Ptr(9999), // not declared on the service
+		ExperimentBackendPortName:   stringPtr("http"),
+	}
+
+	got, err := resolveExperimentBackendPort(service, nil, nil, pluginConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 80 {
+		t.Errorf("got port %d, want the named-port fallback 80", got)
+	}
+}
+
+func TestResolveExperimentBackendPort_ExplicitPortName(t *testing.T) {
+	service := svcWithPorts(
+		corev1.ServicePort{Name: "http", Port: 80},
+		corev1.ServicePort{Name: "admin", Port: 9000},
+	)
+	pluginConfig := Config{ExperimentBackendPortName: stringPtr("admin")}
+
+	got, err := resolveExperimentBackendPort(service, nil, nil, pluginConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 9000 {
+		t.Errorf("got port %d, want 9000", got)
+	}
+}
+
+func TestResolveExperimentBackendPort_CanarySelectorFallback(t *testing.T) {
+	service := svcWithPorts(corev1.ServicePort{Name: "custom", Port: 1234})
+	service.Spec.Selector = map[string]string{"app": "my-app"}
+	canarySvc := svcWithPorts(corev1.ServicePort{Name: "custom", Port: 1234})
+	canarySvc.Spec.Selector = map[string]string{"app": "my-app"}
+	canaryPort := gatewayv1.PortNumber(80)
+
+	got, err := resolveExperimentBackendPort(service, canarySvc, &canaryPort, Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 80 {
+		t.Errorf("got port %d, want canary's port 80", got)
+	}
+}
+
+func TestResolveExperimentBackendPort_CanarySelectorMismatchSkipsFallback(t *testing.T) {
+	service := svcWithPorts(corev1.ServicePort{Name: "http", Port: 8080})
+	service.Spec.Selector = map[string]string{"app": "other-app"}
+	canarySvc := svcWithPorts(corev1.ServicePort{Name: "custom", Port: 1234})
+	canarySvc.Spec.Selector = map[string]string{"app": "my-app"}
+	canaryPort := gatewayv1.PortNumber(1234)
+
+	got, err := resolveExperimentBackendPort(service, canarySvc, &canaryPort, Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 8080 {
+		t.Errorf("got port %d, want the standard-name fallback 8080, not the canary's port", got)
+	}
+}
+
+func TestResolveExperimentBackendPort_StandardHTTPPortName(t *testing.T) {
+	service := svcWithPorts(
+		corev1.ServicePort{Name: "metrics", Port: 9100},
+		corev1.ServicePort{Name: "web", Port: 8080},
+	)
+
+	got, err := resolveExperimentBackendPort(service, nil, nil, Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 8080 {
+		t.Errorf("got port %d, want the standard port name match 8080", got)
+	}
+}
+
+func TestResolveExperimentBackendPort_FirstPortFallback(t *testing.T) {
+	service := svcWithPorts(
+		corev1.ServicePort{Name: "metrics", Port: 9100},
+		corev1.ServicePort{Name: "grpc", Port: 9090},
+	)
+
+	got, err := resolveExperimentBackendPort(service, nil, nil, Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 9100 {
+		t.Errorf("got port %d, want the first declared port 9100", got)
+	}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
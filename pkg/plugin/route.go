@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// BackendRef is a route-kind-agnostic view of a single backendRef, used so the
+// experiment traffic-shifting logic can operate identically over HTTPRoute, GRPCRoute
+// and TLSRoute rules.
+type BackendRef struct {
+	Name      string
+	Namespace *string
+	Port      *gatewayv1.PortNumber
+	Weight    *int32
+}
+
+// RouteHandler lets HandleExperiment manipulate backendRefs and weights on any Gateway
+// API route kind without caring which concrete type backs it.
+type RouteHandler interface {
+	// ListRules returns the number of rules in the route.
+	ListRules() int
+	// GetBackendRefs returns a route-kind-agnostic copy of rule ruleIdx's backendRefs.
+	GetBackendRefs(ruleIdx int) []BackendRef
+	// SetBackendRefs replaces rule ruleIdx's backendRefs.
+	SetBackendRefs(ruleIdx int, refs []BackendRef)
+	// SetWeight updates the weight of the backendRef named name in rule ruleIdx, if
+	// present, and reports whether a match was found.
+	SetWeight(ruleIdx int, name string, weight int32) bool
+	// Annotations returns the route object's annotations.
+	Annotations() map[string]string
+	// SetAnnotation sets (or, if value is empty, removes) an annotation on the route
+	// object.
+	SetAnnotation(key, value string)
+}
+
+// httpRouteHandler adapts *gatewayv1.HTTPRoute to RouteHandler.
+type httpRouteHandler struct {
+	route *gatewayv1.HTTPRoute
+}
+
+// NewHTTPRouteHandler returns a RouteHandler backed by an HTTPRoute.
+func NewHTTPRouteHandler(route *gatewayv1.HTTPRoute) RouteHandler {
+	return &httpRouteHandler{route: route}
+}
+
+func (h *httpRouteHandler) ListRules() int {
+	return len(h.route.Spec.Rules)
+}
+
+func (h *httpRouteHandler) GetBackendRefs(ruleIdx int) []BackendRef {
+	refs := make([]BackendRef, 0, len(h.route.Spec.Rules[ruleIdx].BackendRefs))
+	for _, backendRef := range h.route.Spec.Rules[ruleIdx].BackendRefs {
+		refs = append(refs, BackendRef{
+			Name:      string(backendRef.Name),
+			Namespace: namespaceString(backendRef.Namespace),
+			Port:      backendRef.Port,
+			Weight:    backendRef.Weight,
+		})
+	}
+	return refs
+}
+
+func (h *httpRouteHandler) SetBackendRefs(ruleIdx int, refs []BackendRef) {
+	backendRefs := make([]gatewayv1.HTTPBackendRef, 0, len(refs))
+	for _, ref := range refs {
+		backendRefs = append(backendRefs, gatewayv1.HTTPBackendRef{
+			BackendRef: gatewayv1.BackendRef{
+				BackendObjectReference: gatewayv1.BackendObjectReference{
+					Name:      gatewayv1.ObjectName(ref.Name),
+					Namespace: namespaceRef(ref.Namespace),
+					Port:      ref.Port,
+				},
+				Weight: ref.Weight,
+			},
+		})
+	}
+	h.route.Spec.Rules[ruleIdx].BackendRefs = backendRefs
+}
+
+func (h *httpRouteHandler) SetWeight(ruleIdx int, name string, weight int32) bool {
+	for i, backendRef := range h.route.Spec.Rules[ruleIdx].BackendRefs {
+		if string(backendRef.Name) == name {
+			h.route.Spec.Rules[ruleIdx].BackendRefs[i].Weight = &weight
+			return true
+		}
+	}
+	return false
+}
+
+func (h *httpRouteHandler) Annotations() map[string]string {
+	return h.route.Annotations
+}
+
+func (h *httpRouteHandler) SetAnnotation(key, value string) {
+	h.route.Annotations = setAnnotation(h.route.Annotations, key, value)
+}
+
+// grpcRouteHandler adapts *gatewayv1.GRPCRoute to RouteHandler.
+type grpcRouteHandler struct {
+	route *gatewayv1.GRPCRoute
+}
+
+// NewGRPCRouteHandler returns a RouteHandler backed by a GRPCRoute.
+func NewGRPCRouteHandler(route *gatewayv1.GRPCRoute) RouteHandler {
+	return &grpcRouteHandler{route: route}
+}
+
+func (h *grpcRouteHandler) ListRules() int {
+	return len(h.route.Spec.Rules)
+}
+
+func (h *grpcRouteHandler) GetBackendRefs(ruleIdx int) []BackendRef {
+	refs := make([]BackendRef, 0, len(h.route.Spec.Rules[ruleIdx].BackendRefs))
+	for _, backendRef := range h.route.Spec.Rules[ruleIdx].BackendRefs {
+		refs = append(refs, BackendRef{
+			Name:      string(backendRef.Name),
+			Namespace: namespaceString(backendRef.Namespace),
+			Port:      backendRef.Port,
+			Weight:    backendRef.Weight,
+		})
+	}
+	return refs
+}
+
+func (h *grpcRouteHandler) SetBackendRefs(ruleIdx int, refs []BackendRef) {
+	backendRefs := make([]gatewayv1.GRPCBackendRef, 0, len(refs))
+	for _, ref := range refs {
+		backendRefs = append(backendRefs, gatewayv1.GRPCBackendRef{
+			BackendRef: gatewayv1.BackendRef{
+				BackendObjectReference: gatewayv1.BackendObjectReference{
+					Name:      gatewayv1.ObjectName(ref.Name),
+					Namespace: namespaceRef(ref.Namespace),
+					Port:      ref.Port,
+				},
+				Weight: ref.Weight,
+			},
+		})
+	}
+	h.route.Spec.Rules[ruleIdx].BackendRefs = backendRefs
+}
+
+func (h *grpcRouteHandler) SetWeight(ruleIdx int, name string, weight int32) bool {
+	for i, backendRef := range h.route.Spec.Rules[ruleIdx].BackendRefs {
+		if string(backendRef.Name) == name {
+			h.route.Spec.Rules[ruleIdx].BackendRefs[i].Weight = &weight
+			return true
+		}
+	}
+	return false
+}
+
+func (h *grpcRouteHandler) Annotations() map[string]string {
+	return h.route.Annotations
+}
+
+func (h *grpcRouteHandler) SetAnnotation(key, value string) {
+	h.route.Annotations = setAnnotation(h.route.Annotations, key, value)
+}
+
+// tlsRouteHandler adapts *gatewayv1alpha2.TLSRoute to RouteHandler.
+type tlsRouteHandler struct {
+	route *gatewayv1alpha2.TLSRoute
+}
+
+// NewTLSRouteHandler returns a RouteHandler backed by a TLSRoute.
+func NewTLSRouteHandler(route *gatewayv1alpha2.TLSRoute) RouteHandler {
+	return &tlsRouteHandler{route: route}
+}
+
+func (h *tlsRouteHandler) ListRules() int {
+	return len(h.route.Spec.Rules)
+}
+
+func (h *tlsRouteHandler) GetBackendRefs(ruleIdx int) []BackendRef {
+	refs := make([]BackendRef, 0, len(h.route.Spec.Rules[ruleIdx].BackendRefs))
+	for _, backendRef := range h.route.Spec.Rules[ruleIdx].BackendRefs {
+		refs = append(refs, BackendRef{
+			Name:      string(backendRef.Name),
+			Namespace: namespaceString(backendRef.Namespace),
+			Port:      backendRef.Port,
+			Weight:    backendRef.Weight,
+		})
+	}
+	return refs
+}
+
+func (h *tlsRouteHandler) SetBackendRefs(ruleIdx int, refs []BackendRef) {
+	backendRefs := make([]gatewayv1.BackendRef, 0, len(refs))
+	for _, ref := range refs {
+		backendRefs = append(backendRefs, gatewayv1.BackendRef{
+			BackendObjectReference: gatewayv1.BackendObjectReference{
+				Name:      gatewayv1.ObjectName(ref.Name),
+				Namespace: namespaceRef(ref.Namespace),
+				Port:      ref.Port,
+			},
+			Weight: ref.Weight,
+		})
+	}
+	h.route.Spec.Rules[ruleIdx].BackendRefs = backendRefs
+}
+
+func (h *tlsRouteHandler) SetWeight(ruleIdx int, name string, weight int32) bool {
+	for i, backendRef := range h.route.Spec.Rules[ruleIdx].BackendRefs {
+		if string(backendRef.Name) == name {
+			h.route.Spec.Rules[ruleIdx].BackendRefs[i].Weight = &weight
+			return true
+		}
+	}
+	return false
+}
+
+func (h *tlsRouteHandler) Annotations() map[string]string {
+	return h.route.Annotations
+}
+
+func (h *tlsRouteHandler) SetAnnotation(key, value string) {
+	h.route.Annotations = setAnnotation(h.route.Annotations, key, value)
+}
+
+// setAnnotation sets key to value in annotations, creating the map if necessary, or
+// removes key entirely when value is empty. It returns the (possibly new) map so
+// callers can assign it back to an object whose annotations were previously nil.
+func setAnnotation(annotations map[string]string, key, value string) map[string]string {
+	if value == "" {
+		delete(annotations, key)
+		return annotations
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	return annotations
+}
+
+// namespaceString converts a *gatewayv1.Namespace to a plain *string.
+func namespaceString(ns *gatewayv1.Namespace) *string {
+	if ns == nil {
+		return nil
+	}
+	s := string(*ns)
+	return &s
+}
+
+// namespaceRef converts a plain *string back to a *gatewayv1.Namespace.
+func namespaceRef(ns *string) *gatewayv1.Namespace {
+	if ns == nil {
+		return nil
+	}
+	n := gatewayv1.Namespace(*ns)
+	return &n
+}
@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// These tests exercise HandleGRPCExperiment and HandleTLSExperiment end to end against
+// the upstream Gateway API route types, the same way TestHandleExperiment_MultiRuleHTTPRoute
+// exercises HandleExperiment, so the grpcRouteHandler and tlsRouteHandler adapters in
+// route.go get the same coverage as httpRouteHandler.
+
+func TestHandleGRPCExperiment_AddsExperimentBackend(t *testing.T) {
+	stableService := "my-app-stable"
+	canaryService := "my-app-canary"
+	experimentService := "my-app-experiment"
+
+	grpcRoute := &gatewayv1.GRPCRoute{
+		Spec: gatewayv1.GRPCRouteSpec{
+			Rules: []gatewayv1.GRPCRouteRule{
+				{
+					BackendRefs: []gatewayv1.GRPCBackendRef{
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(stableService)}, Weight: weightPtr(100)}},
+						{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(canaryService)}, Weight: weightPtr(0)}},
+					},
+				},
+			},
+		},
+	}
+
+	clientset := k8sfake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: canaryService, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: experimentService, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 8090}}},
+		},
+	)
+
+	rollout := &v1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "default"},
+		Spec: v1alpha1.RolloutSpec{
+			Strategy: v1alpha1.RolloutStrategy{
+				Canary: &v1alpha1.CanaryStrategy{
+					StableService: stableService,
+					CanaryService: canaryService,
+				},
+			},
+		},
+		Status: v1alpha1.RolloutStatus{
+			Canary: v1alpha1.CanaryStatus{
+				CurrentExperiment: "my-app-experiment-run",
+				Weights: &v1alpha1.TrafficWeights{
+					Canary:     v1alpha1.WeightDestination{Weight: 20},
+					Additional: []v1alpha1.WeightDestination{{ServiceName: experimentService, Weight: 10}},
+				},
+			},
+		},
+	}
+
+	if err := HandleGRPCExperiment(context.Background(), clientset, nil, testLogger(), rollout, grpcRoute, Config{}); err != nil {
+		t.Fatalf("HandleGRPCExperiment returned error: %v", err)
+	}
+
+	wantStableWeight := int32(70)
+	var gotStableWeight, gotExperimentWeight *int32
+	foundExperiment := false
+	for _, backendRef := range grpcRoute.Spec.Rules[0].BackendRefs {
+		switch string(backendRef.Name) {
+		case stableService:
+			gotStableWeight = backendRef.Weight
+		case experimentService:
+			foundExperiment = true
+			gotExperimentWeight = backendRef.Weight
+		}
+	}
+	if gotStableWeight == nil || *gotStableWeight != wantStableWeight {
+		t.Errorf("stable weight = %v, want %d", gotStableWeight, wantStableWeight)
+	}
+	if !foundExperiment {
+		t.Errorf("experiment backend %s not added", experimentService)
+	}
+	if gotExperimentWeight == nil || *gotExperimentWeight != 10 {
+		t.Errorf("experiment weight = %v, want 10", gotExperimentWeight)
+	}
+}
+
+func TestHandleTLSExperiment_RemovesExperimentBackendWhenInactive(t *testing.T) {
+	stableService := "my-app-stable"
+	canaryService := "my-app-canary"
+	experimentService := "my-app-experiment"
+
+	tlsRoute := &gatewayv1alpha2.TLSRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{ExperimentBackendsAnnotation: experimentService},
+		},
+		Spec: gatewayv1alpha2.TLSRouteSpec{
+			Rules: []gatewayv1alpha2.TLSRouteRule{
+				{
+					BackendRefs: []gatewayv1.BackendRef{
+						{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(stableService)}, Weight: weightPtr(70)},
+						{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(canaryService)}, Weight: weightPtr(20)},
+						{BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(experimentService)}, Weight: weightPtr(10)},
+					},
+				},
+			},
+		},
+	}
+
+	clientset := k8sfake.NewSimpleClientset()
+
+	rollout := &v1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "default"},
+		Spec: v1alpha1.RolloutSpec{
+			Strategy: v1alpha1.RolloutStrategy{
+				Canary: &v1alpha1.CanaryStrategy{
+					StableService: stableService,
+					CanaryService: canaryService,
+				},
+			},
+		},
+		// CurrentExperiment is empty: the experiment has completed, so the previously
+		// added experiment backend should be removed and the stable weight restored.
+	}
+
+	if err := HandleTLSExperiment(context.Background(), clientset, nil, testLogger(), rollout, tlsRoute, Config{}); err != nil {
+		t.Fatalf("HandleTLSExperiment returned error: %v", err)
+	}
+
+	gotBackends := tlsRoute.Spec.Rules[0].BackendRefs
+	if len(gotBackends) != 2 {
+		t.Fatalf("backendRefs = %d entries, want 2 (stable + canary only): %+v", len(gotBackends), gotBackends)
+	}
+	for _, backendRef := range gotBackends {
+		switch string(backendRef.Name) {
+		case stableService:
+			if backendRef.Weight == nil || *backendRef.Weight != 100 {
+				t.Errorf("stable weight = %v, want 100", backendRef.Weight)
+			}
+		case canaryService:
+			if backendRef.Weight == nil || *backendRef.Weight != 0 {
+				t.Errorf("canary weight = %v, want 0", backendRef.Weight)
+			}
+		default:
+			t.Errorf("unexpected backendRef left on route: %s", backendRef.Name)
+		}
+	}
+}